@@ -0,0 +1,323 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/evcc-io/evcc/vehicle/bluelink"
+)
+
+var sampleLabels = []string{"vin", "name", "model", "brand"}
+
+var (
+	rangeDesc       = prometheus.NewDesc("ev_range", "Electric vehicle range", sampleLabels, nil)
+	socDesc         = prometheus.NewDesc("ev_soc", "Electric vehicle state of charge", sampleLabels, nil)
+	statusDesc      = prometheus.NewDesc("ev_status", "Electric vehicle status", sampleLabels, nil)
+	finishTimeDesc  = prometheus.NewDesc("ev_finish_time", "Electric charging finish time", sampleLabels, nil)
+	odometerDesc    = prometheus.NewDesc("ev_odometer", "Electric odometer", sampleLabels, nil)
+	lastSuccessDesc = prometheus.NewDesc(
+		"ev_last_successful_poll_timestamp_seconds",
+		"Unix timestamp of the last successful poll for this vehicle", sampleLabels, nil,
+	)
+
+	scrapeDurationDesc = prometheus.NewDesc("ev_scrape_duration_seconds", "Duration of the last upstream poll triggered by a scrape", nil, nil)
+	scrapeSuccessDesc  = prometheus.NewDesc("ev_scrape_success", "Whether the last upstream poll succeeded for every configured vehicle", nil, nil)
+	cacheAgeDesc       = prometheus.NewDesc("ev_cache_age_seconds", "Age of the metrics currently being served, relative to when they were last polled", nil, nil)
+	apiErrorsDesc      = prometheus.NewDesc("ev_api_request_errors_total", "Total number of failed upstream API requests, by endpoint", []string{"endpoint"}, nil)
+	influxErrorsDesc   = prometheus.NewDesc("ev_influx_write_errors_total", "Total number of failed InfluxDB line protocol writes", nil, nil)
+	tokenRefreshDesc   = prometheus.NewDesc("ev_token_refresh_timestamp_seconds", "Unix timestamp the Bluelink refresh token was last persisted to -token-file", nil, nil)
+	tokenFailuresDesc  = prometheus.NewDesc("ev_token_refresh_failures_total", "Total number of failed Bluelink logins or token persists", nil, nil)
+
+	chargePowerDesc    = prometheus.NewDesc("ev_charge_power_watts", "Current charging power", sampleLabels, nil)
+	plugConnectedDesc  = prometheus.NewDesc("ev_plug_connected", "Whether the vehicle is plugged in", sampleLabels, nil)
+	targetSocDesc      = prometheus.NewDesc("ev_target_soc", "Configured target state of charge", sampleLabels, nil)
+	climaterActiveDesc = prometheus.NewDesc("ev_climater_active", "Whether the cabin climate control is running", sampleLabels, nil)
+	battery12vDesc     = prometheus.NewDesc("ev_battery_12v_soc", "12V auxiliary battery state of charge", sampleLabels, nil)
+	latitudeDesc       = prometheus.NewDesc("ev_latitude", "Last known vehicle latitude", sampleLabels, nil)
+	longitudeDesc      = prometheus.NewDesc("ev_longitude", "Last known vehicle longitude", sampleLabels, nil)
+)
+
+// evCollector is a prometheus.Collector that polls all configured vehicles
+// on demand from Collect, instead of running a free-standing background
+// goroutine that writes into registered gauges. Because the upstream
+// Bluelink/evcc APIs are heavily rate-limited, results younger than ttl are
+// served from cache, and concurrent scrapes that land while a poll is
+// already in flight wait for it to finish rather than triggering another.
+type evCollector struct {
+	vehicles []vehicleConfig
+	username string
+	tm       *tokenManager
+	ttl      time.Duration
+	influx   *influxWriter
+
+	mu           sync.Mutex
+	lastPoll     time.Time
+	samples      []vehicleSample
+	lastSucc     map[string]float64 // vin -> unix timestamp of last fully successful poll
+	apiErrors    map[string]float64 // endpoint -> cumulative error count
+	influxErrors float64            // cumulative count of failed influx writes
+	warned       map[string]bool    // "vin:capability" -> already logged as unsupported
+	inflight     chan struct{}      // non-nil while a poll is in flight; closed when it completes
+}
+
+func newEVCollector(vehicles []vehicleConfig, username string, tm *tokenManager, ttl time.Duration, influx *influxWriter) *evCollector {
+	return &evCollector{
+		vehicles:  vehicles,
+		username:  username,
+		tm:        tm,
+		ttl:       ttl,
+		influx:    influx,
+		lastSucc:  map[string]float64{},
+		apiErrors: map[string]float64{},
+		warned:    map[string]bool{},
+	}
+}
+
+func (c *evCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rangeDesc
+	ch <- socDesc
+	ch <- statusDesc
+	ch <- finishTimeDesc
+	ch <- odometerDesc
+	ch <- lastSuccessDesc
+	ch <- scrapeDurationDesc
+	ch <- scrapeSuccessDesc
+	ch <- cacheAgeDesc
+	ch <- apiErrorsDesc
+	ch <- influxErrorsDesc
+	ch <- tokenRefreshDesc
+	ch <- tokenFailuresDesc
+	ch <- chargePowerDesc
+	ch <- plugConnectedDesc
+	ch <- targetSocDesc
+	ch <- climaterActiveDesc
+	ch <- battery12vDesc
+	ch <- latitudeDesc
+	ch <- longitudeDesc
+}
+
+func (c *evCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	samples, cacheAge, apiErrors, allOK := c.refresh()
+	duration := time.Since(start).Seconds()
+
+	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration)
+	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, boolToFloat(allOK))
+	ch <- prometheus.MustNewConstMetric(cacheAgeDesc, prometheus.GaugeValue, cacheAge.Seconds())
+
+	for endpoint, count := range apiErrors {
+		ch <- prometheus.MustNewConstMetric(apiErrorsDesc, prometheus.CounterValue, count, endpoint)
+	}
+
+	c.mu.Lock()
+	influxErrors := c.influxErrors
+	c.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(influxErrorsDesc, prometheus.CounterValue, influxErrors)
+
+	if c.tm != nil {
+		lastRefresh, failures := c.tm.stats()
+		ch <- prometheus.MustNewConstMetric(tokenRefreshDesc, prometheus.GaugeValue, lastRefresh)
+		ch <- prometheus.MustNewConstMetric(tokenFailuresDesc, prometheus.CounterValue, failures)
+	}
+
+	for _, s := range samples {
+		labels := []string{s.vc.VIN, s.vc.Name, s.vc.Model, s.vc.Backend}
+
+		if s.hasRange {
+			ch <- prometheus.MustNewConstMetric(rangeDesc, prometheus.GaugeValue, float64(s.rangeKm), labels...)
+		}
+		if s.hasSoc {
+			ch <- prometheus.MustNewConstMetric(socDesc, prometheus.GaugeValue, s.soc, labels...)
+		}
+		if s.hasStatus {
+			ch <- prometheus.MustNewConstMetric(statusDesc, prometheus.GaugeValue, s.status, labels...)
+		}
+		if s.hasFinishTime {
+			ch <- prometheus.MustNewConstMetric(finishTimeDesc, prometheus.GaugeValue, s.finishTime, labels...)
+		}
+		if s.hasOdometer {
+			ch <- prometheus.MustNewConstMetric(odometerDesc, prometheus.GaugeValue, s.odometer, labels...)
+		}
+		if s.hasChargePower {
+			ch <- prometheus.MustNewConstMetric(chargePowerDesc, prometheus.GaugeValue, s.chargePower, labels...)
+		}
+		if s.hasPlugConnected {
+			ch <- prometheus.MustNewConstMetric(plugConnectedDesc, prometheus.GaugeValue, s.plugConnected, labels...)
+		}
+		if s.hasTargetSoc {
+			ch <- prometheus.MustNewConstMetric(targetSocDesc, prometheus.GaugeValue, s.targetSoc, labels...)
+		}
+		if s.hasClimaterActive {
+			ch <- prometheus.MustNewConstMetric(climaterActiveDesc, prometheus.GaugeValue, s.climaterActive, labels...)
+		}
+		if s.hasBattery12V {
+			ch <- prometheus.MustNewConstMetric(battery12vDesc, prometheus.GaugeValue, s.battery12V, labels...)
+		}
+		if s.hasPosition {
+			ch <- prometheus.MustNewConstMetric(latitudeDesc, prometheus.GaugeValue, s.latitude, labels...)
+			ch <- prometheus.MustNewConstMetric(longitudeDesc, prometheus.GaugeValue, s.longitude, labels...)
+		}
+
+		c.mu.Lock()
+		lastSucc := c.lastSucc[s.vc.VIN]
+		c.mu.Unlock()
+		if lastSucc != 0 {
+			ch <- prometheus.MustNewConstMetric(lastSuccessDesc, prometheus.GaugeValue, lastSucc, labels...)
+		}
+	}
+}
+
+// refresh returns the current samples, serving them from cache when younger
+// than ttl. A poll already in flight is waited on rather than duplicated, so
+// concurrent scrapes coalesce into a single upstream request.
+func (c *evCollector) refresh() ([]vehicleSample, time.Duration, map[string]float64, bool) {
+	c.mu.Lock()
+	if !c.lastPoll.IsZero() && time.Since(c.lastPoll) < c.ttl {
+		samples, age, errs := c.snapshotLocked()
+		c.mu.Unlock()
+		return samples, age, errs, allSucceeded(samples)
+	}
+
+	if c.inflight != nil {
+		wait := c.inflight
+		c.mu.Unlock()
+		<-wait
+		c.mu.Lock()
+		samples, age, errs := c.snapshotLocked()
+		c.mu.Unlock()
+		return samples, age, errs, allSucceeded(samples)
+	}
+
+	done := make(chan struct{})
+	c.inflight = done
+	c.mu.Unlock()
+
+	samples := c.pollAll()
+
+	c.mu.Lock()
+	c.samples = samples
+	c.lastPoll = time.Now()
+	c.inflight = nil
+	_, age, errs := c.snapshotLocked()
+	c.mu.Unlock()
+	close(done)
+
+	// Mirror the sampled values to InfluxDB without making the scrape that
+	// triggered this poll wait on it.
+	if c.influx != nil {
+		go c.writeInflux(samples)
+	}
+
+	return samples, age, errs, allSucceeded(samples)
+}
+
+func (c *evCollector) snapshotLocked() ([]vehicleSample, time.Duration, map[string]float64) {
+	errs := make(map[string]float64, len(c.apiErrors))
+	for k, v := range c.apiErrors {
+		errs[k] = v
+	}
+	return c.samples, time.Since(c.lastPoll), errs
+}
+
+// pollAll polls every configured vehicle and updates the collector's
+// cumulative error counters and per-vehicle last-success timestamps. All
+// hyundai/kia vehicles share one bluelink.API session per backend, built on
+// first use and reused for the rest of this poll cycle, so an account with
+// several VINs only logs in once instead of once per vehicle.
+func (c *evCollector) pollAll() []vehicleSample {
+	samples := make([]vehicleSample, 0, len(c.vehicles))
+
+	bluelinkAPIs := map[string]*bluelink.API{}
+	bluelinkErrs := map[string]error{}
+
+	for _, vc := range c.vehicles {
+		var provider interface{}
+		var err error
+
+		switch vc.Backend {
+		case "hyundai", "kia":
+			api, ok := bluelinkAPIs[vc.Backend]
+			if !ok {
+				if cachedErr, tried := bluelinkErrs[vc.Backend]; tried {
+					err = cachedErr
+				} else {
+					api, err = newBluelinkAPI(vc.Backend, c.username, c.tm)
+					if err != nil {
+						bluelinkErrs[vc.Backend] = err
+					} else {
+						bluelinkAPIs[vc.Backend] = api
+					}
+				}
+			}
+			if err == nil {
+				provider, err = newBluelinkVehicle(api, vc)
+			}
+		default:
+			provider, err = newVehicleProvider(vc)
+		}
+
+		if err != nil {
+			log.Printf("vin %s (%s): %v", vc.VIN, vc.Backend, err)
+			c.mu.Lock()
+			c.apiErrors["login"]++
+			c.mu.Unlock()
+			samples = append(samples, vehicleSample{vc: vc, ok: false})
+			continue
+		}
+
+		s := pollVehicle(provider, vc, func(endpoint string) {
+			c.mu.Lock()
+			c.apiErrors[endpoint]++
+			c.mu.Unlock()
+		}, func(capability string) {
+			key := vc.VIN + ":" + capability
+			c.mu.Lock()
+			alreadyWarned := c.warned[key]
+			c.warned[key] = true
+			c.mu.Unlock()
+			if !alreadyWarned {
+				log.Printf("vin %s: %s not supported by this vehicle, will keep skipping it", vc.VIN, capability)
+			}
+		})
+		samples = append(samples, s)
+
+		if s.ok {
+			c.mu.Lock()
+			c.lastSucc[vc.VIN] = float64(time.Now().Unix())
+			c.mu.Unlock()
+		}
+	}
+
+	return samples
+}
+
+// writeInflux pushes samples to InfluxDB, counting failures instead of
+// propagating them: a flaky Influx instance must never interrupt polling or
+// the Prometheus endpoint.
+func (c *evCollector) writeInflux(samples []vehicleSample) {
+	if err := c.influx.write(samples); err != nil {
+		log.Printf("influx write error: %v", err)
+		c.mu.Lock()
+		c.influxErrors++
+		c.mu.Unlock()
+	}
+}
+
+func allSucceeded(samples []vehicleSample) bool {
+	for _, s := range samples {
+		if !s.ok {
+			return false
+		}
+	}
+	return true
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestCollector returns a collector with a single vehicle on a backend
+// name that newVehicleProvider doesn't recognize, so pollAll fails fast with
+// a "login" api error and never touches the network - exactly what refresh's
+// cache/coalescing logic needs to be exercised deterministically.
+func newTestCollector(ttl time.Duration) *evCollector {
+	vehicles := []vehicleConfig{{VIN: "VIN1", Backend: "no-such-backend"}}
+	return newEVCollector(vehicles, "", nil, ttl, nil)
+}
+
+func TestRefreshServesFromCacheWithinTTL(t *testing.T) {
+	c := newTestCollector(time.Minute)
+
+	samples, _, errs, ok := c.refresh()
+	if ok {
+		t.Fatalf("ok = true, want false: the one configured vehicle has an unsupported backend")
+	}
+	if len(samples) != 1 || samples[0].ok {
+		t.Fatalf("samples = %+v, want one failed sample", samples)
+	}
+	if errs["login"] != 1 {
+		t.Fatalf("apiErrors[login] = %v, want 1 after the first poll", errs["login"])
+	}
+
+	// Within ttl, a second refresh must be served from cache rather than
+	// polling again.
+	if _, _, errs, _ := c.refresh(); errs["login"] != 1 {
+		t.Fatalf("apiErrors[login] = %v after a cached refresh, want still 1", errs["login"])
+	}
+}
+
+func TestRefreshRepollsAfterTTLExpires(t *testing.T) {
+	c := newTestCollector(time.Millisecond)
+
+	if _, _, errs, _ := c.refresh(); errs["login"] != 1 {
+		t.Fatalf("apiErrors[login] = %v after the first poll, want 1", errs["login"])
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, _, errs, _ := c.refresh(); errs["login"] != 2 {
+		t.Fatalf("apiErrors[login] = %v after the ttl expired, want 2", errs["login"])
+	}
+}
+
+func TestRefreshCoalescesConcurrentCallers(t *testing.T) {
+	c := newTestCollector(time.Minute)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			defer wg.Done()
+			c.refresh()
+		}()
+	}
+	wg.Wait()
+
+	_, _, errs, _ := c.refresh()
+	if errs["login"] != 1 {
+		t.Fatalf("apiErrors[login] = %v after %d concurrent callers, want 1: concurrent scrapes must coalesce into a single upstream poll", errs["login"], callers)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// vehicleConfig describes a single vehicle to poll, either supplied via a
+// repeated -vin flag or loaded from -config. Backend defaults to the
+// top-level -backend flag when left empty, so a config file only needs to
+// override it for vehicles that don't match the default brand.
+type vehicleConfig struct {
+	VIN     string                 `json:"vin" yaml:"vin"`
+	Name    string                 `json:"name" yaml:"name"`
+	Model   string                 `json:"model" yaml:"model"`
+	Backend string                 `json:"backend" yaml:"backend"`
+	Other   map[string]interface{} `json:"other" yaml:"other"`
+}
+
+// fileConfig is the shape expected in a -config YAML/JSON file, e.g.:
+//
+//	vehicles:
+//	  - vin: "KMHXX00XXXX000000"
+//	    name: "Ioniq"
+//	    backend: hyundai
+//	  - vin: "5YJXXXXXXXXXXXXXX"
+//	    backend: tesla
+//	    other:
+//	      tokens:
+//	        access: "..."
+//	        refresh: "..."
+type fileConfig struct {
+	Vehicles []vehicleConfig `json:"vehicles" yaml:"vehicles"`
+}
+
+// vinList implements flag.Value so -vin can be passed multiple times.
+type vinList []string
+
+func (v *vinList) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *vinList) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+// loadVehicles merges VINs given via repeated -vin flags with vehicles
+// declared in an optional -config file, and fills in the default backend
+// for any vehicle that doesn't name its own.
+func loadVehicles(vins vinList, configPath, defaultBackend string) ([]vehicleConfig, error) {
+	var vehicles []vehicleConfig
+
+	for _, vin := range vins {
+		vehicles = append(vehicles, vehicleConfig{VIN: vin})
+	}
+
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read config file: %w", err)
+		}
+
+		var cfg fileConfig
+		switch {
+		case strings.HasSuffix(configPath, ".json"):
+			err = json.Unmarshal(data, &cfg)
+		default:
+			err = yaml.Unmarshal(data, &cfg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse config file: %w", err)
+		}
+
+		vehicles = append(vehicles, cfg.Vehicles...)
+	}
+
+	if len(vehicles) == 0 {
+		return nil, fmt.Errorf("no vehicles configured, pass -vin or -config")
+	}
+
+	for i := range vehicles {
+		if vehicles[i].Backend == "" {
+			vehicles[i].Backend = defaultBackend
+		}
+	}
+
+	return vehicles, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// influxWriter pushes polled vehicle samples to InfluxDB as line protocol,
+// alongside the Prometheus /metrics endpoint. It understands both the
+// InfluxDB 1.x `?db=` write API (basic auth) and the 2.x `?org=&bucket=`
+// API (token auth), selected by which query parameters are present in the
+// configured URL.
+type influxWriter struct {
+	client   *http.Client
+	writeURL string
+	username string
+	password string
+	token    string
+}
+
+// newInfluxWriter parses a URL of the form
+// http[s]://user:pass@host[:port]/db?org=...&bucket=... into a writer ready
+// to POST line protocol to the appropriate write endpoint.
+func newInfluxWriter(rawURL string) (*influxWriter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid influx url: %w", err)
+	}
+
+	w := &influxWriter{client: &http.Client{Timeout: 10 * time.Second}}
+
+	if u.User != nil {
+		w.username = u.User.Username()
+		w.password, _ = u.User.Password()
+	}
+
+	query := u.Query()
+	org := query.Get("org")
+	bucket := query.Get("bucket")
+	db := strings.TrimPrefix(u.Path, "/")
+
+	writeURL := *u
+	writeURL.User = nil
+
+	if org != "" || bucket != "" {
+		// InfluxDB 2.x: token auth, org/bucket addressing. The token is the
+		// password half of a user:token@ userinfo if one was given, or
+		// otherwise the bare token@host form this flag's help text
+		// documents, in which case url.Parse put it in the username.
+		w.token = w.password
+		if w.token == "" {
+			w.token = w.username
+		}
+		writeURL.Path = "/api/v2/write"
+		q := url.Values{"org": {org}, "bucket": {bucket}, "precision": {"s"}}
+		writeURL.RawQuery = q.Encode()
+	} else {
+		// InfluxDB 1.x: basic auth, database addressing.
+		writeURL.Path = "/write"
+		writeURL.RawQuery = url.Values{"db": {db}, "precision": {"s"}}.Encode()
+	}
+
+	w.writeURL = writeURL.String()
+
+	return w, nil
+}
+
+// write encodes every fully or partially successful sample as a line
+// protocol point in the "ioniq" measurement, tagged by vin, and POSTs them
+// in a single request.
+func (w *influxWriter) write(samples []vehicleSample) error {
+	var buf bytes.Buffer
+
+	for _, s := range samples {
+		var fields []string
+		if s.hasSoc {
+			fields = append(fields, fmt.Sprintf("soc=%f", s.soc))
+		}
+		if s.hasRange {
+			fields = append(fields, fmt.Sprintf("range_km=%d", s.rangeKm))
+		}
+		if s.hasOdometer {
+			fields = append(fields, fmt.Sprintf("odometer_km=%f", s.odometer))
+		}
+		if s.hasStatus {
+			fields = append(fields, fmt.Sprintf("status=%f", s.status))
+		}
+		if s.hasFinishTime {
+			fields = append(fields, fmt.Sprintf("finish_time=%f", s.finishTime))
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "ioniq,vin=%s %s\n", escapeTag(s.vc.VIN), strings.Join(fields, ","))
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.writeURL, &buf)
+	if err != nil {
+		return err
+	}
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	} else if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("influx write failed with status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// escapeTag escapes the characters InfluxDB line protocol treats specially
+// in tag values.
+func escapeTag(v string) string {
+	r := strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ")
+	return r.Replace(v)
+}
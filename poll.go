@@ -0,0 +1,227 @@
+package main
+
+import (
+	"log"
+
+	"github.com/evcc-io/evcc/api"
+)
+
+// climater is implemented by providers that can report whether the cabin
+// climate control is currently running.
+type climater interface {
+	Climater() (bool, error)
+}
+
+// battery12v is implemented by providers that can additionally report the
+// 12V auxiliary battery's state of charge. evcc has no dedicated interface
+// for this since it isn't relevant to charge control, so this exporter
+// defines its own.
+type battery12v interface {
+	Battery12V() (float64, error)
+}
+
+// vehicleSample holds everything collected from a single poll of one
+// vehicle. Fields are only valid when their "has*" flag is set, so that a
+// vehicle whose backend doesn't implement a given capability (or whose poll
+// partially failed) simply omits that metric instead of reporting a zero.
+type vehicleSample struct {
+	vc vehicleConfig
+
+	hasRange bool
+	rangeKm  int64
+
+	hasSoc bool
+	soc    float64
+
+	hasStatus bool
+	status    float64
+
+	hasFinishTime bool
+	finishTime    float64
+
+	hasOdometer bool
+	odometer    float64
+
+	hasChargePower bool
+	chargePower    float64
+
+	hasPlugConnected bool
+	plugConnected    float64
+
+	hasTargetSoc bool
+	targetSoc    float64
+
+	hasClimaterActive bool
+	climaterActive    float64
+
+	hasBattery12V bool
+	battery12V    float64
+
+	hasPosition bool
+	latitude    float64
+	longitude   float64
+
+	ok bool
+}
+
+// pollVehicle fetches a single vehicle's metrics. provider only needs to
+// implement whichever of the optional evcc api interfaces it supports;
+// capabilities it doesn't implement are skipped. errEndpoints is incremented
+// by endpoint name for every failed call, so the caller can turn it into
+// ev_api_request_errors_total. warnMissing is called once per capability
+// the vehicle's provider doesn't implement at all, so the caller can log it
+// once instead of on every poll.
+func pollVehicle(provider interface{}, vc vehicleConfig, errEndpoints func(endpoint string), warnMissing func(capability string)) vehicleSample {
+	s := vehicleSample{vc: vc, ok: true}
+
+	if rg, impl := provider.(api.VehicleRange); impl {
+		rangeKm, err := rg.Range()
+		if err != nil {
+			log.Printf("vin %s: range error: %v", vc.VIN, err)
+			errEndpoints("range")
+			s.ok = false
+		} else {
+			s.hasRange, s.rangeKm = true, rangeKm
+		}
+	}
+
+	if b, impl := provider.(api.Battery); impl {
+		soc, err := b.Soc()
+		if err != nil {
+			log.Printf("vin %s: soc error: %v", vc.VIN, err)
+			errEndpoints("soc")
+			s.ok = false
+		} else {
+			s.hasSoc, s.soc = true, soc
+		}
+	}
+
+	if cs, impl := provider.(api.ChargeState); impl {
+		statusString, err := cs.Status()
+		if err != nil {
+			log.Printf("vin %s: status error: %v", vc.VIN, err)
+			errEndpoints("status")
+			s.ok = false
+		} else {
+			// ev_plug_connected is only derived from the recognized "A".."F"
+			// codes below ("A" = not connected, "B".."F" = connected in some
+			// state), never from the "" case, since that just means the
+			// status field was empty and isn't evidence of either plug state.
+			switch statusString.String() {
+			case "":
+				s.hasStatus, s.status = true, 0
+			case "A":
+				s.hasStatus, s.status = true, 1
+				s.hasPlugConnected, s.plugConnected = true, 0
+			case "B":
+				s.hasStatus, s.status = true, 2
+				s.hasPlugConnected, s.plugConnected = true, 1
+			case "C":
+				s.hasStatus, s.status = true, 3
+				s.hasPlugConnected, s.plugConnected = true, 1
+			case "D":
+				s.hasStatus, s.status = true, 4
+				s.hasPlugConnected, s.plugConnected = true, 1
+			case "E":
+				s.hasStatus, s.status = true, 5
+				s.hasPlugConnected, s.plugConnected = true, 1
+			case "F":
+				s.hasStatus, s.status = true, 6
+				s.hasPlugConnected, s.plugConnected = true, 1
+			default:
+				log.Printf("vin %s: unknown status: %s", vc.VIN, statusString)
+				errEndpoints("status")
+				s.ok = false
+			}
+		}
+	}
+
+	if ft, impl := provider.(api.VehicleFinishTimer); impl {
+		finishTime, err := ft.FinishTime()
+		if err != nil {
+			log.Printf("vin %s: finish time error: %v", vc.VIN, err)
+			errEndpoints("finishtime")
+			s.ok = false
+		} else {
+			s.hasFinishTime, s.finishTime = true, float64(finishTime.Unix())
+		}
+	}
+
+	if od, impl := provider.(api.VehicleOdometer); impl {
+		odometer, err := od.Odometer()
+		if err != nil {
+			log.Printf("vin %s: odometer error: %v", vc.VIN, err)
+			errEndpoints("odometer")
+			s.ok = false
+		} else {
+			s.hasOdometer, s.odometer = true, odometer
+		}
+	}
+
+	if cp, impl := provider.(api.Meter); impl {
+		power, err := cp.CurrentPower()
+		if err != nil {
+			log.Printf("vin %s: charge power error: %v", vc.VIN, err)
+			errEndpoints("charge_power")
+			s.ok = false
+		} else {
+			s.hasChargePower, s.chargePower = true, power
+		}
+	} else {
+		warnMissing("charge_power")
+	}
+
+	if sl, impl := provider.(api.SocLimiter); impl {
+		target, err := sl.GetLimitSoc()
+		if err != nil {
+			log.Printf("vin %s: target soc error: %v", vc.VIN, err)
+			errEndpoints("target_soc")
+			s.ok = false
+		} else {
+			s.hasTargetSoc, s.targetSoc = true, float64(target)
+		}
+	} else {
+		warnMissing("target_soc")
+	}
+
+	if cl, impl := provider.(climater); impl {
+		active, err := cl.Climater()
+		if err != nil {
+			log.Printf("vin %s: climater error: %v", vc.VIN, err)
+			errEndpoints("climater")
+			s.ok = false
+		} else {
+			s.hasClimaterActive, s.climaterActive = true, boolToFloat(active)
+		}
+	} else {
+		warnMissing("climater")
+	}
+
+	if b12, impl := provider.(battery12v); impl {
+		soc, err := b12.Battery12V()
+		if err != nil {
+			log.Printf("vin %s: 12V battery error: %v", vc.VIN, err)
+			errEndpoints("battery_12v")
+			s.ok = false
+		} else {
+			s.hasBattery12V, s.battery12V = true, soc
+		}
+	} else {
+		warnMissing("battery_12v")
+	}
+
+	if pos, impl := provider.(api.VehiclePosition); impl {
+		lat, lon, err := pos.Position()
+		if err != nil {
+			log.Printf("vin %s: position error: %v", vc.VIN, err)
+			errEndpoints("position")
+			s.ok = false
+		} else {
+			s.hasPosition, s.latitude, s.longitude = true, lat, lon
+		}
+	} else {
+		warnMissing("position")
+	}
+
+	return s
+}
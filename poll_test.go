@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/evcc-io/evcc/api"
+)
+
+// fakeFullVehicle implements every optional interface pollVehicle looks for,
+// each backed by a func field so a test can fail or omit individual
+// capabilities without needing a distinct type per combination.
+type fakeFullVehicle struct {
+	rangeFn      func() (int64, error)
+	socFn        func() (float64, error)
+	statusFn     func() (api.ChargeStatus, error)
+	finishTimeFn func() (time.Time, error)
+	odometerFn   func() (float64, error)
+	powerFn      func() (float64, error)
+	limitSocFn   func() (int64, error)
+	climaterFn   func() (bool, error)
+	battery12vFn func() (float64, error)
+	positionFn   func() (float64, float64, error)
+}
+
+func (f *fakeFullVehicle) Range() (int64, error)               { return f.rangeFn() }
+func (f *fakeFullVehicle) Soc() (float64, error)               { return f.socFn() }
+func (f *fakeFullVehicle) Status() (api.ChargeStatus, error)   { return f.statusFn() }
+func (f *fakeFullVehicle) FinishTime() (time.Time, error)      { return f.finishTimeFn() }
+func (f *fakeFullVehicle) Odometer() (float64, error)          { return f.odometerFn() }
+func (f *fakeFullVehicle) CurrentPower() (float64, error)      { return f.powerFn() }
+func (f *fakeFullVehicle) GetLimitSoc() (int64, error)         { return f.limitSocFn() }
+func (f *fakeFullVehicle) Climater() (bool, error)             { return f.climaterFn() }
+func (f *fakeFullVehicle) Battery12V() (float64, error)        { return f.battery12vFn() }
+func (f *fakeFullVehicle) Position() (float64, float64, error) { return f.positionFn() }
+
+// newFakeFullVehicle returns a fake where every capability succeeds with a
+// zero value, so a test only needs to override the ones it cares about.
+func newFakeFullVehicle() *fakeFullVehicle {
+	return &fakeFullVehicle{
+		rangeFn:      func() (int64, error) { return 0, nil },
+		socFn:        func() (float64, error) { return 0, nil },
+		statusFn:     func() (api.ChargeStatus, error) { return api.StatusNone, nil },
+		finishTimeFn: func() (time.Time, error) { return time.Time{}, nil },
+		odometerFn:   func() (float64, error) { return 0, nil },
+		powerFn:      func() (float64, error) { return 0, nil },
+		limitSocFn:   func() (int64, error) { return 0, nil },
+		climaterFn:   func() (bool, error) { return false, nil },
+		battery12vFn: func() (float64, error) { return 0, nil },
+		positionFn:   func() (float64, float64, error) { return 0, 0, nil },
+	}
+}
+
+// fakeBareVehicle implements none of pollVehicle's optional interfaces.
+type fakeBareVehicle struct{}
+
+func TestPollVehicleBareProviderSkipsEverything(t *testing.T) {
+	var missing []string
+	s := pollVehicle(&fakeBareVehicle{}, vehicleConfig{VIN: "VIN1"}, func(string) {
+		t.Fatal("errEndpoints should not be called for an unimplemented capability")
+	}, func(capability string) {
+		missing = append(missing, capability)
+	})
+
+	if !s.ok {
+		t.Errorf("ok = false, want true when no capability was attempted")
+	}
+	if s.hasRange || s.hasSoc || s.hasStatus || s.hasFinishTime || s.hasOdometer ||
+		s.hasChargePower || s.hasTargetSoc || s.hasClimaterActive || s.hasBattery12V || s.hasPosition {
+		t.Errorf("expected no has* flag set, got %+v", s)
+	}
+
+	want := []string{"charge_power", "target_soc", "climater", "battery_12v", "position"}
+	if len(missing) != len(want) {
+		t.Fatalf("warnMissing calls = %v, want %v", missing, want)
+	}
+	for i, w := range want {
+		if missing[i] != w {
+			t.Errorf("warnMissing[%d] = %q, want %q", i, missing[i], w)
+		}
+	}
+}
+
+func TestPollVehicleSuccessSetsHasFlags(t *testing.T) {
+	v := newFakeFullVehicle()
+	v.rangeFn = func() (int64, error) { return 123, nil }
+	v.socFn = func() (float64, error) { return 55.5, nil }
+	v.statusFn = func() (api.ChargeStatus, error) { return api.ChargeStatus("C"), nil }
+	v.odometerFn = func() (float64, error) { return 9001, nil }
+	v.powerFn = func() (float64, error) { return 7400, nil }
+	v.limitSocFn = func() (int64, error) { return 80, nil }
+	v.climaterFn = func() (bool, error) { return true, nil }
+	v.battery12vFn = func() (float64, error) { return 90, nil }
+	v.positionFn = func() (float64, float64, error) { return 52.1, 9.3, nil }
+
+	s := pollVehicle(v, vehicleConfig{VIN: "VIN1"}, func(string) {
+		t.Fatal("errEndpoints should not be called when every capability succeeds")
+	}, func(string) {
+		t.Fatal("warnMissing should not be called when every capability is implemented")
+	})
+
+	if !s.ok {
+		t.Fatalf("ok = false, want true")
+	}
+	if !s.hasRange || s.rangeKm != 123 {
+		t.Errorf("range = (%v, %v), want (true, 123)", s.hasRange, s.rangeKm)
+	}
+	if !s.hasSoc || s.soc != 55.5 {
+		t.Errorf("soc = (%v, %v), want (true, 55.5)", s.hasSoc, s.soc)
+	}
+	if !s.hasStatus || s.status != 3 {
+		t.Errorf("status = (%v, %v), want (true, 3)", s.hasStatus, s.status)
+	}
+	if !s.hasPlugConnected || s.plugConnected != 1 {
+		t.Errorf("plugConnected = (%v, %v), want (true, 1)", s.hasPlugConnected, s.plugConnected)
+	}
+	if !s.hasTargetSoc || s.targetSoc != 80 {
+		t.Errorf("targetSoc = (%v, %v), want (true, 80)", s.hasTargetSoc, s.targetSoc)
+	}
+	if !s.hasClimaterActive || s.climaterActive != 1 {
+		t.Errorf("climaterActive = (%v, %v), want (true, 1)", s.hasClimaterActive, s.climaterActive)
+	}
+	if !s.hasPosition || s.latitude != 52.1 || s.longitude != 9.3 {
+		t.Errorf("position = (%v, %v, %v), want (true, 52.1, 9.3)", s.hasPosition, s.latitude, s.longitude)
+	}
+}
+
+func TestPollVehicleStatusEmptyDoesNotImplyPlugState(t *testing.T) {
+	v := newFakeFullVehicle()
+
+	s := pollVehicle(v, vehicleConfig{VIN: "VIN1"}, func(string) {}, func(string) {})
+
+	if !s.hasStatus || s.status != 0 {
+		t.Errorf("status = (%v, %v), want (true, 0) for an empty status", s.hasStatus, s.status)
+	}
+	if s.hasPlugConnected {
+		t.Errorf("hasPlugConnected = true, want false: an empty status isn't evidence of either plug state")
+	}
+	if !s.ok {
+		t.Errorf("ok = false, want true for a recognized (empty) status")
+	}
+}
+
+func TestPollVehicleUnknownStatusFailsTheSample(t *testing.T) {
+	v := newFakeFullVehicle()
+	v.statusFn = func() (api.ChargeStatus, error) { return api.ChargeStatus("Z"), nil }
+
+	var failedEndpoints []string
+	s := pollVehicle(v, vehicleConfig{VIN: "VIN1"}, func(endpoint string) {
+		failedEndpoints = append(failedEndpoints, endpoint)
+	}, func(string) {})
+
+	if s.hasStatus {
+		t.Errorf("hasStatus = true, want false for an unrecognized status code")
+	}
+	if s.ok {
+		t.Errorf("ok = true, want false: an unrecognized status is a failed poll, not a silently skipped metric")
+	}
+	if len(failedEndpoints) != 1 || failedEndpoints[0] != "status" {
+		t.Errorf("errEndpoints calls = %v, want [status]", failedEndpoints)
+	}
+}
+
+func TestPollVehicleCapabilityErrorFailsTheSample(t *testing.T) {
+	v := newFakeFullVehicle()
+	v.socFn = func() (float64, error) { return 0, errors.New("boom") }
+
+	var failedEndpoints []string
+	s := pollVehicle(v, vehicleConfig{VIN: "VIN1"}, func(endpoint string) {
+		failedEndpoints = append(failedEndpoints, endpoint)
+	}, func(string) {})
+
+	if s.hasSoc {
+		t.Errorf("hasSoc = true, want false when Soc() errors")
+	}
+	if s.ok {
+		t.Errorf("ok = true, want false when a capability call errors")
+	}
+	if len(failedEndpoints) != 1 || failedEndpoints[0] != "soc" {
+		t.Errorf("errEndpoints calls = %v, want [soc]", failedEndpoints)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// initialLoginBackoff and maxLoginBackoff bound the delay tokenManager
+// imposes between login attempts after a transient (non-auth) failure, so a
+// network blip or Bluelink outage doesn't get hammered at the collector's
+// normal poll cadence. Doubles on each consecutive transient failure, reset
+// on the next successful login.
+const (
+	initialLoginBackoff = 30 * time.Second
+	maxLoginBackoff     = 30 * time.Minute
+)
+
+// tokenManager holds the current Bluelink refresh token and persists it to
+// -token-file whenever it changes. Bluelink rotates the refresh token on
+// every login, so without this the token handed to -token on the command
+// line would only ever work for the first poll.
+type tokenManager struct {
+	path string
+	seed string
+
+	mu           sync.Mutex
+	current      string
+	lastRefresh  float64 // unix timestamp of the last successfully persisted token
+	failures     float64 // cumulative count of failed refreshes/persists
+	backoffStep  time.Duration
+	backoffUntil float64 // unix timestamp before which login attempts should be skipped
+}
+
+// newTokenManager loads the current token from path, falling back to seed
+// (the -token flag) when the file doesn't exist yet, e.g. on first run.
+func newTokenManager(path, seed string) (*tokenManager, error) {
+	current := seed
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			// first run: nothing to load, seed from -token
+		case err != nil:
+			return nil, fmt.Errorf("cannot read token file: %w", err)
+		default:
+			current = strings.TrimSpace(string(data))
+		}
+	}
+
+	return &tokenManager{path: path, seed: seed, current: current}, nil
+}
+
+// get returns the token to use for the next login attempt.
+func (t *tokenManager) get() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current
+}
+
+// update records a freshly rotated refresh token and persists it to disk.
+func (t *tokenManager) update(token string) error {
+	t.mu.Lock()
+	t.current = token
+	t.mu.Unlock()
+
+	if err := t.persist(token); err != nil {
+		t.mu.Lock()
+		t.failures++
+		t.mu.Unlock()
+		return err
+	}
+
+	t.mu.Lock()
+	t.lastRefresh = float64(time.Now().Unix())
+	t.mu.Unlock()
+	return nil
+}
+
+// reseed resets the current token back to the -token flag's value, for use
+// after Bluelink rejects the persisted token outright (e.g. it was revoked
+// or a previous write raced with a login from another process).
+func (t *tokenManager) reseed() {
+	t.mu.Lock()
+	t.current = t.seed
+	t.mu.Unlock()
+}
+
+// recordFailure counts a failed refresh without changing the current token.
+func (t *tokenManager) recordFailure() {
+	t.mu.Lock()
+	t.failures++
+	t.mu.Unlock()
+}
+
+// backoffRemaining returns how long the caller should wait before the next
+// login attempt, or zero if no backoff is in effect. Only
+// recordTransientFailure advances this; auth failures are handled by
+// reseeding and retrying immediately instead of backing off.
+func (t *tokenManager) backoffRemaining() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	remaining := t.backoffUntil - float64(time.Now().Unix())
+	if remaining <= 0 {
+		return 0
+	}
+	return time.Duration(remaining) * time.Second
+}
+
+// recordTransientFailure pushes the next permitted login attempt out by an
+// increasing delay, capped at maxLoginBackoff, so repeated network errors
+// don't get retried at the collector's normal poll cadence.
+func (t *tokenManager) recordTransientFailure() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.backoffStep == 0 {
+		t.backoffStep = initialLoginBackoff
+	} else if t.backoffStep < maxLoginBackoff {
+		t.backoffStep *= 2
+		if t.backoffStep > maxLoginBackoff {
+			t.backoffStep = maxLoginBackoff
+		}
+	}
+	t.backoffUntil = float64(time.Now().Unix()) + t.backoffStep.Seconds()
+}
+
+// resetBackoff clears any pending login backoff after a successful login.
+func (t *tokenManager) resetBackoff() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.backoffStep = 0
+	t.backoffUntil = 0
+}
+
+// stats reports the metrics the collector exposes for token refreshes.
+func (t *tokenManager) stats() (lastRefresh, failures float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastRefresh, t.failures
+}
+
+// persist atomically writes token to t.path (temp file + rename) with 0600
+// permissions. A no-op when no -token-file was configured.
+func (t *tokenManager) persist(token string) error {
+	if t.path == "" {
+		return nil
+	}
+
+	dir := filepath.Dir(t.path)
+	tmp, err := os.CreateTemp(dir, ".token-*.tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create temp token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(token); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write temp token file: %w", err)
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot chmod temp token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot close temp token file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), t.path)
+}
+
+// isAuthError is a best-effort heuristic for telling Bluelink's auth
+// rejections (stale/invalid refresh token) apart from transient network
+// errors, based on the wording httpClient/evcc wrap such failures in.
+func isAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, needle := range []string{"401", "403", "unauthorized", "forbidden", "invalid_grant", "invalid token"} {
+		if strings.Contains(msg, needle) {
+			return true
+		}
+	}
+	return false
+}
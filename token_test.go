@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenManagerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+
+	tm, err := newTokenManager(path, "seed-token")
+	if err != nil {
+		t.Fatalf("newTokenManager: %v", err)
+	}
+	if got := tm.get(); got != "seed-token" {
+		t.Fatalf("get() before any update = %q, want seed-token", got)
+	}
+
+	if err := tm.update("rotated-token"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got := tm.get(); got != "rotated-token" {
+		t.Errorf("get() after update = %q, want rotated-token", got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading persisted token file: %v", err)
+	}
+	if string(data) != "rotated-token" {
+		t.Errorf("persisted file contents = %q, want rotated-token", data)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0o600 {
+		t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	tm2, err := newTokenManager(path, "seed-token")
+	if err != nil {
+		t.Fatalf("newTokenManager reloading existing file: %v", err)
+	}
+	if got := tm2.get(); got != "rotated-token" {
+		t.Errorf("reloaded get() = %q, want rotated-token", got)
+	}
+
+	tm2.reseed()
+	if got := tm2.get(); got != "seed-token" {
+		t.Errorf("get() after reseed = %q, want seed-token", got)
+	}
+}
+
+func TestTokenManagerMissingFileFallsBackToSeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "does-not-exist-yet")
+
+	tm, err := newTokenManager(path, "seed-token")
+	if err != nil {
+		t.Fatalf("newTokenManager: %v", err)
+	}
+	if got := tm.get(); got != "seed-token" {
+		t.Errorf("get() on first run = %q, want seed-token", got)
+	}
+}
+
+func TestTokenManagerBackoff(t *testing.T) {
+	tm, err := newTokenManager("", "seed-token")
+	if err != nil {
+		t.Fatalf("newTokenManager: %v", err)
+	}
+
+	if remaining := tm.backoffRemaining(); remaining != 0 {
+		t.Fatalf("backoffRemaining() before any failure = %v, want 0", remaining)
+	}
+
+	tm.recordTransientFailure()
+	if remaining := tm.backoffRemaining(); remaining <= 0 {
+		t.Errorf("backoffRemaining() after a transient failure = %v, want > 0", remaining)
+	}
+
+	tm.resetBackoff()
+	if remaining := tm.backoffRemaining(); remaining != 0 {
+		t.Errorf("backoffRemaining() after resetBackoff = %v, want 0", remaining)
+	}
+}